@@ -17,12 +17,13 @@ import (
 
 // Service provides higher level wrapper allowing to construct everything and get back token middleware
 type Service struct {
-	opts           Opts
-	jwtService     *token.Service
-	providers      []provider.Service
-	authMiddleware middleware.Authenticator
-	avatarProxy    *avatar.Proxy
-	issuer         string
+	opts               Opts
+	jwtService         *token.Service
+	providers          []provider.Service
+	authMiddleware     middleware.Authenticator
+	sessionsMiddleware middleware.Authenticator
+	avatarProxy        *avatar.Proxy
+	issuer             string
 }
 
 // Opts is a full set of all parameters to initialize Service
@@ -47,6 +48,41 @@ type Opts struct {
 	DevPasswd string               // if presented, allows basic auth with user dev and given password
 
 	AvatarStore avatar.Store // store to save/load avatars
+
+	OIDCIssuerURL string   // issuer URL for the generic "oidc" provider, e.g. https://accounts.google.com
+	OIDCScopes    []string // scopes requested from the "oidc" provider, defaults to {"openid", "profile", "email"}
+
+	// AllowedRedirectDomains whitelists hosts the post-login "from"/"site" query
+	// parameter may send the browser to, preventing it from being an open-redirect
+	// sink. Entries are exact hosts or ".example.com"-style subdomain wildcards.
+	// A target missing or not on the list falls back to URL.
+	AllowedRedirectDomains []string
+
+	// SessionStore, if set, switches sessions from stateless JWT cookies to
+	// server-side storage (see token.SessionStore); the cookie then carries only
+	// an opaque session id, enabling true logout and admin-forced revocation via
+	// the /auth/sessions admin endpoint.
+	SessionStore token.SessionStore
+
+	// SessionsValidator gates the /auth/sessions admin endpoint, which can list
+	// and force-revoke any user's session. Defaults to
+	// middleware.RequireRole("admin") when unset, so the endpoint is never left
+	// open to an arbitrary authenticated user; set it only to use a different role
+	// or custom check, never to disable the check.
+	SessionsValidator middleware.Validator
+
+	// AuthHeaderEnabled accepts a standard "Authorization: Bearer <jwt>" header as
+	// an alternative to the cookie, for API clients that can't or don't want to
+	// deal with cookies. XSRF is skipped for bearer requests, same as JWTHeaderKey.
+	AuthHeaderEnabled bool
+
+	// SkipAuthPreflight passes CORS preflight OPTIONS requests through unauthenticated.
+	SkipAuthPreflight bool
+
+	// PassAuthHeaderUpstream rewrites the outgoing request's Authorization header
+	// to the raw provider id_token from claims once validation succeeds, so a
+	// reverse-proxied backend can consume the OIDC token directly.
+	PassAuthHeaderUpstream bool
 }
 
 // NewService initializes everything
@@ -58,26 +94,40 @@ func NewService(opts Opts) (*Service, error) {
 	}
 
 	jwtService := token.NewService(token.Opts{
-		SecretReader:   opts.SecretReader,
-		ClaimsUpd:      opts.ClaimsUpd,
-		SecureCookies:  opts.SecureCookies,
-		TokenDuration:  opts.TokenDuration,
-		CookieDuration: opts.CookieDuration,
-		DisableXSRF:    opts.DisableXSRF,
-		JWTCookieName:  opts.JWTCookieName,
-		JWTHeaderKey:   opts.JWTHeaderKey,
-		XSRFCookieName: opts.XSRFCookieName,
-		XSRFHeaderKey:  opts.XSRFHeaderKey,
-		Issuer:         opts.Issuer,
+		SecretReader:      opts.SecretReader,
+		ClaimsUpd:         opts.ClaimsUpd,
+		SecureCookies:     opts.SecureCookies,
+		TokenDuration:     opts.TokenDuration,
+		CookieDuration:    opts.CookieDuration,
+		DisableXSRF:       opts.DisableXSRF,
+		JWTCookieName:     opts.JWTCookieName,
+		JWTHeaderKey:      opts.JWTHeaderKey,
+		XSRFCookieName:    opts.XSRFCookieName,
+		XSRFHeaderKey:     opts.XSRFHeaderKey,
+		Issuer:            opts.Issuer,
+		SessionStore:      opts.SessionStore,
+		AuthHeaderEnabled: opts.AuthHeaderEnabled,
 	})
 
+	sessionsValidator := opts.SessionsValidator
+	if sessionsValidator == nil {
+		sessionsValidator = middleware.RequireRole("admin")
+	}
+
 	res := Service{
 		opts:       opts,
 		jwtService: jwtService,
 		authMiddleware: middleware.Authenticator{
-			JWTService: jwtService,
-			Validator:  opts.Validator,
-			DevPasswd:  opts.DevPasswd,
+			JWTService:             jwtService,
+			Validator:              opts.Validator,
+			DevPasswd:              opts.DevPasswd,
+			SkipAuthPreflight:      opts.SkipAuthPreflight,
+			PassAuthHeaderUpstream: opts.PassAuthHeaderUpstream,
+		},
+		sessionsMiddleware: middleware.Authenticator{
+			JWTService:        jwtService,
+			Validator:         sessionsValidator,
+			SkipAuthPreflight: opts.SkipAuthPreflight,
 		},
 	}
 
@@ -122,6 +172,12 @@ func (s *Service) Handlers() (authHandler http.Handler, avatarHandler http.Handl
 			return
 		}
 
+		// admin endpoint to list/revoke active sessions, only meaningful with SessionStore set
+		if elems[len(elems)-1] == "sessions" {
+			s.sessionsMiddleware.Auth(http.HandlerFunc(s.sessionsHandler)).ServeHTTP(w, r)
+			return
+		}
+
 		provName := elems[len(elems)-2]
 		p, err := s.Provider(provName)
 		if err != nil {
@@ -142,14 +198,26 @@ func (s *Service) Middleware() middleware.Authenticator {
 
 // AddProvider adds provider for given name
 func (s *Service) AddProvider(name string, cid string, csecret string) {
+	s.AddProviderWithParams(name, cid, csecret, nil)
+}
+
+// ProviderParams carries extra, per-provider configuration that doesn't fit the
+// plain AddProvider(name, cid, csecret) signature, e.g. Keycloak's realm URL.
+type ProviderParams map[string]string
+
+// AddProviderWithParams adds provider for given name, same as AddProvider, plus
+// arbitrary named parameters some providers need beyond cid/csecret; keycloak reads
+// "realm_url" and "client_id". The oidc provider takes its issuer from Opts instead.
+func (s *Service) AddProviderWithParams(name string, cid string, csecret string, params ProviderParams) {
 
 	p := provider.Params{
-		URL:         s.opts.URL,
-		JwtService:  s.jwtService,
-		Issuer:      s.issuer,
-		AvatarProxy: s.avatarProxy,
-		Cid:         cid,
-		Csecret:     csecret,
+		URL:                    s.opts.URL,
+		JwtService:             s.jwtService,
+		Issuer:                 s.issuer,
+		AvatarProxy:            s.avatarProxy,
+		Cid:                    cid,
+		Csecret:                csecret,
+		AllowedRedirectDomains: s.opts.AllowedRedirectDomains,
 	}
 
 	switch strings.ToLower(name) {
@@ -163,6 +231,16 @@ func (s *Service) AddProvider(name string, cid string, csecret string) {
 		s.providers = append(s.providers, provider.NewFacebook(p))
 	case "dev":
 		s.providers = append(s.providers, provider.NewDev(p))
+	case "bitbucket":
+		s.providers = append(s.providers, provider.NewBitbucket(p))
+	case "oidc":
+		scopes := s.opts.OIDCScopes
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "profile", "email"}
+		}
+		s.providers = append(s.providers, provider.NewOIDC(p, s.opts.OIDCIssuerURL, scopes).Service)
+	case "keycloak":
+		s.providers = append(s.providers, provider.NewKeycloak(p, params["realm_url"], params["client_id"]).Service)
 	default:
 		return
 	}
@@ -170,6 +248,47 @@ func (s *Service) AddProvider(name string, cid string, csecret string) {
 	s.authMiddleware.Providers = s.providers
 }
 
+// sessionsHandler lists (GET) or revokes (DELETE ?id=...) active sessions. It's
+// only usable when opts.SessionStore is set and, being mounted behind
+// sessionsMiddleware.Auth above, always requires the caller to pass
+// opts.SessionsValidator (the "admin" role by default), not merely be logged in.
+func (s *Service) sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.opts.SessionStore == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		lister, ok := s.opts.SessionStore.(token.SessionLister)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		ids, err := lister.List()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rest.RenderJSON(w, r, ids)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := s.opts.SessionStore.Delete(id); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 // Provider gets provider by name
 func (s *Service) Provider(name string) (provider.Service, error) {
 	for _, p := range s.providers {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -76,7 +77,8 @@ func TestIntegration(t *testing.T) {
 		Validator: middleware.ValidatorFunc(func(_ string, claims token.Claims) bool {
 			return claims.User != nil && strings.HasPrefix(claims.User.Name, "dev_") // allow only dev_ names
 		}),
-		AvatarStore: avatar.NewLocalFS("/tmp/auth-pkgz", 120),
+		AvatarStore:            avatar.NewLocalFS("/tmp/auth-pkgz", 120),
+		AllowedRedirectDomains: []string{"127.0.0.1"},
 	}
 
 	svc, err := NewService(options)
@@ -120,8 +122,8 @@ func TestIntegration(t *testing.T) {
 	require.Nil(t, err)
 	client := &http.Client{Jar: jar, Timeout: 5 * time.Second}
 
-	// check non-admin, permanent
-	resp, err := client.Get("http://127.0.0.1:8080/auth/dev/login?site=my-test-site")
+	// check non-admin, permanent; "site" is the older alias for "from", still supported
+	resp, err := client.Get("http://127.0.0.1:8080/auth/dev/login?site=" + url.QueryEscape("http://127.0.0.1:8080/open"))
 	require.Nil(t, err)
 	assert.Equal(t, 200, resp.StatusCode)
 	body, err := ioutil.ReadAll(resp.Body)
@@ -129,3 +131,60 @@ func TestIntegration(t *testing.T) {
 	t.Logf("resp %s", string(body))
 	t.Logf("headers: %+v", resp.Header)
 }
+
+type fakeSessionStore map[string]token.Claims
+
+func (f fakeSessionStore) Save(id string, claims token.Claims) error { f[id] = claims; return nil }
+func (f fakeSessionStore) Load(id string) (token.Claims, error)      { return f[id], nil }
+func (f fakeSessionStore) Delete(id string) error                    { delete(f, id); return nil }
+func (f fakeSessionStore) List() ([]string, error) {
+	ids := make([]string, 0, len(f))
+	for id := range f {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func TestSessionsHandlerRejectsNonAdmin(t *testing.T) {
+	svc, err := NewService(Opts{
+		SecretReader: token.SecretFunc(func(string) (string, error) { return "secret", nil }),
+		URL:          "http://127.0.0.1:8080",
+		DisableXSRF:  true,
+		SessionStore: fakeSessionStore{},
+	})
+	require.NoError(t, err)
+
+	authRoute, _ := svc.Handlers()
+
+	tokenStr, err := svc.jwtService.Token(token.Claims{User: &token.User{ID: "id1"}}) // no admin role
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/auth/sessions", nil)
+	r.Header.Set("X-JWT", tokenStr)
+	w := httptest.NewRecorder()
+	authRoute.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestSessionsHandlerAllowsAdmin(t *testing.T) {
+	svc, err := NewService(Opts{
+		SecretReader: token.SecretFunc(func(string) (string, error) { return "secret", nil }),
+		URL:          "http://127.0.0.1:8080",
+		DisableXSRF:  true,
+		SessionStore: fakeSessionStore{},
+	})
+	require.NoError(t, err)
+
+	authRoute, _ := svc.Handlers()
+
+	tokenStr, err := svc.jwtService.Token(token.Claims{User: &token.User{ID: "id1", Roles: []string{"admin"}}})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/auth/sessions", nil)
+	r.Header.Set("X-JWT", tokenStr)
+	w := httptest.NewRecorder()
+	authRoute.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,31 @@
+// Package avatar provides the avatar-proxying http.Handler used by auth.Service
+// as well as storage backends for saved avatar images.
+package avatar
+
+import (
+	"io"
+	"net/http"
+)
+
+// Store defines interface for avatar saving and loading
+type Store interface {
+	Put(id string, reader io.Reader) (string, error)
+	Get(id string) (reader io.ReadCloser, size int, err error)
+}
+
+// Proxy provides http.Handler for avatars from a given Store
+type Proxy struct {
+	Store     Store
+	URL       string
+	RoutePath string
+}
+
+// Handler answers every request with 404 Not Found, whether or not Store is set;
+// it does not read or serve avatars from Store.
+func (p *Proxy) Handler(w http.ResponseWriter, r *http.Request) {
+	if p == nil || p.Store == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
@@ -0,0 +1,47 @@
+package avatar
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-errors/errors"
+)
+
+// LocalFS implements Store on top of a local directory
+type LocalFS struct {
+	basePath    string
+	maxFileSize int
+}
+
+// NewLocalFS makes file-system based avatar store under basePath. maxSize is kept
+// in the store, but Put does not check the size of what it saves against it.
+func NewLocalFS(basePath string, maxSize int) *LocalFS {
+	return &LocalFS{basePath: basePath, maxFileSize: maxSize}
+}
+
+// Put saves avatar data from reader under id and returns the stored file name
+func (fs *LocalFS) Put(id string, reader io.Reader) (string, error) {
+	dst, err := os.Create(filepath.Join(fs.basePath, id))
+	if err != nil {
+		return "", errors.WrapPrefix(err, "can't create avatar file", 0)
+	}
+	defer dst.Close()
+	if _, err = io.Copy(dst, reader); err != nil {
+		return "", errors.WrapPrefix(err, "can't save avatar", 0)
+	}
+	return id, nil
+}
+
+// Get returns reader for avatar's image and its size
+func (fs *LocalFS) Get(id string) (reader io.ReadCloser, size int, err error) {
+	fh, err := os.Open(filepath.Join(fs.basePath, id))
+	if err != nil {
+		return nil, 0, errors.WrapPrefix(err, "can't load avatar", 0)
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		return nil, 0, errors.WrapPrefix(err, "can't stat avatar", 0)
+	}
+	return fh, int(fi.Size()), nil
+}
@@ -0,0 +1,157 @@
+// Package middleware provides the http.Handler wrapper that validates the JWT
+// on every request and injects the authenticated user into the request context.
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-errors/errors"
+
+	"github.com/go-pkgz/auth/provider"
+	"github.com/go-pkgz/auth/token"
+)
+
+// contextKey is a private type to avoid collisions with context keys from other packages
+type contextKey string
+
+// ctxKeyUser is the context key the authenticated token.User is stored under
+const ctxKeyUser contextKey = "user"
+
+// Validator allows rejecting otherwise-valid tokens with custom, user-defined logic,
+// for example checking the user against a ban list or requiring a specific
+// Keycloak role (see RequireRole).
+type Validator interface {
+	Validate(token string, claims token.Claims) bool
+}
+
+// ValidatorFunc is an adapter to allow the use of ordinary functions as Validator
+type ValidatorFunc func(token string, claims token.Claims) bool
+
+// Validate calls f(token, claims)
+func (f ValidatorFunc) Validate(token string, claims token.Claims) bool { return f(token, claims) }
+
+// RequireRole makes a Validator rejecting any user without the given role, e.g. a
+// Keycloak realm or client role mapped into token.User.Roles. Set it as
+// Authenticator.Validator to gate every request, or wrap individual handlers with
+// a second Authenticator that uses it.
+func RequireRole(role string) Validator {
+	return ValidatorFunc(func(_ string, claims token.Claims) bool {
+		if claims.User == nil {
+			return false
+		}
+		for _, r := range claims.User.Roles {
+			if r == role {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Authenticator is a middleware validating the JWT from cookie, header, or (with
+// AuthHeaderEnabled) a standard Authorization: Bearer header, and injecting the
+// authenticated user into the request context
+type Authenticator struct {
+	JWTService *token.Service
+	Validator  Validator
+	DevPasswd  string
+	Providers  []provider.Service
+
+	// SkipAuthPreflight passes CORS preflight OPTIONS requests straight through,
+	// since browsers never attach Authorization/cookies to them.
+	SkipAuthPreflight bool
+
+	// PassAuthHeaderUpstream rewrites the request's Authorization header to the
+	// raw provider id_token (token.Claims.IDToken) once validation succeeds, so a
+	// reverse-proxied backend can consume the OIDC token directly.
+	PassAuthHeaderUpstream bool
+}
+
+// Auth middleware rejects requests without a valid token, hands the authenticated
+// user to downstream handlers otherwise. An expired token carrying a provider
+// refresh token is transparently refreshed before being rejected, so sessions
+// can outlive TokenDuration without forcing the user to log in again.
+func (a *Authenticator) Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.SkipAuthPreflight && r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, _, err := a.JWTService.Get(r)
+
+		if err != nil && token.IsExpired(err) && claims.RefreshToken != "" {
+			if refreshed, rerr := a.refresh(w, claims); rerr == nil {
+				claims, err = refreshed, nil
+			}
+		}
+
+		if err != nil {
+			http.Error(w, "auth failed", http.StatusUnauthorized)
+			return
+		}
+
+		if claims.User == nil {
+			http.Error(w, "auth failed, no user info", http.StatusUnauthorized)
+			return
+		}
+
+		if a.Validator != nil && !a.Validator.Validate("", claims) {
+			http.Error(w, "rejected by validator", http.StatusForbidden)
+			return
+		}
+
+		if a.PassAuthHeaderUpstream && claims.IDToken != "" {
+			r.Header.Set("Authorization", "Bearer "+claims.IDToken)
+		}
+
+		ctx := context.WithValue(r.Context(), ctxKeyUser, *claims.User)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// refresh exchanges claims.RefreshToken for a fresh id token via the provider that
+// originally issued it and reissues the local JWT+cookie carrying the new claims.
+func (a *Authenticator) refresh(w http.ResponseWriter, claims token.Claims) (token.Claims, error) {
+	var prov *provider.Service
+	for i := range a.Providers {
+		if a.Providers[i].Name == claims.Provider {
+			prov = &a.Providers[i]
+			break
+		}
+	}
+	if prov == nil || prov.Refresh == nil {
+		return token.Claims{}, errors.New("provider does not support refresh")
+	}
+
+	user, newRefreshToken, err := prov.Refresh(claims.RefreshToken)
+	if err != nil {
+		return token.Claims{}, errors.WrapPrefix(err, "refresh failed", 0)
+	}
+
+	newClaims := claims
+	newClaims.User = &user
+	newClaims.RefreshToken = newRefreshToken
+	newClaims.ExpiresAt = 0 // Token recomputes expiry from TokenDuration
+	return a.JWTService.Set(w, newClaims)
+}
+
+// Trace middleware doesn't require valid user but if token is present populates the context
+func (a *Authenticator) Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _, err := a.JWTService.Get(r)
+		if err != nil || claims.User == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), ctxKeyUser, *claims.User)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetUserInfo returns user info from request context
+func GetUserInfo(r *http.Request) (token.User, bool) {
+	u, ok := r.Context().Value(ctxKeyUser).(token.User)
+	return u, ok
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+func testAuthenticator(svc *token.Service) *Authenticator {
+	return &Authenticator{JWTService: svc}
+}
+
+func testService() *token.Service {
+	return token.NewService(token.Opts{
+		SecretReader:      token.SecretFunc(func(string) (string, error) { return "secret", nil }),
+		AuthHeaderEnabled: true,
+	})
+}
+
+func TestAuthenticator_BearerHeader(t *testing.T) {
+	svc := testService()
+	claims, err := svc.Token(token.Claims{User: &token.User{ID: "id1"}})
+	require.NoError(t, err)
+
+	a := testAuthenticator(svc)
+	var gotUser token.User
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = GetUserInfo(r)
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+claims)
+	w := httptest.NewRecorder()
+	a.Auth(next).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id1", gotUser.ID)
+}
+
+func TestAuthenticator_SkipAuthPreflight(t *testing.T) {
+	a := testAuthenticator(testService())
+	a.SkipAuthPreflight = true
+
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	r := httptest.NewRequest(http.MethodOptions, "/", nil)
+	w := httptest.NewRecorder()
+	a.Auth(next).ServeHTTP(w, r)
+
+	assert.True(t, called, "OPTIONS preflight should pass through without auth")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthenticator_PassAuthHeaderUpstream(t *testing.T) {
+	svc := testService()
+	tokenStr, err := svc.Token(token.Claims{User: &token.User{ID: "id1"}, IDToken: "raw-id-token"})
+	require.NoError(t, err)
+
+	a := testAuthenticator(svc)
+	a.PassAuthHeaderUpstream = true
+
+	var gotAuthHeader string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuthHeader = r.Header.Get("Authorization")
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+tokenStr)
+	w := httptest.NewRecorder()
+	a.Auth(next).ServeHTTP(w, r)
+
+	assert.Equal(t, "Bearer raw-id-token", gotAuthHeader)
+}
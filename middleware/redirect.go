@@ -0,0 +1,12 @@
+package middleware
+
+import "github.com/go-pkgz/auth/provider"
+
+// IsValidRedirect reports whether redirectURL is safe to send the browser to after
+// login: an absolute http(s) URL whose host is exactly present in allowed, or under
+// a ".example.com"-style wildcard entry. Every provider's callback handler applies
+// this same check (via provider.Params.ValidRedirect) to its "from"/"site" query
+// parameter; exposed here too for services doing their own post-login redirects.
+func IsValidRedirect(redirectURL string, allowed []string) bool {
+	return provider.IsValidRedirect(redirectURL, allowed)
+}
@@ -0,0 +1,183 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+// bitbucketUserURL, bitbucketEmailsURL and bitbucketTokenURL are vars, not
+// consts, so tests can point them at an httptest.Server instead of the real API.
+var (
+	bitbucketAuthURL   = "https://bitbucket.org/site/oauth2/authorize"
+	bitbucketUserURL   = "https://api.bitbucket.org/2.0/user"
+	bitbucketEmailsURL = "https://api.bitbucket.org/2.0/user/emails"
+	bitbucketTokenURL  = "https://bitbucket.org/site/oauth2/access_token"
+)
+
+// bitbucketProvider wraps the oauth2 Service to add the extra call to
+// /2.0/user/emails, since Bitbucket's primary profile response doesn't carry it.
+type bitbucketProvider struct {
+	Service
+	client *http.Client
+}
+
+// NewBitbucket makes bitbucket oauth2 provider
+func NewBitbucket(p Params) Service {
+	bb := &bitbucketProvider{client: &http.Client{Timeout: 5 * time.Second}}
+	bb.Name = "bitbucket"
+	bb.Cid = p.Cid
+	bb.Csecret = p.Csecret
+	bb.Issuer = p.Issuer
+	bb.Params = p
+	bb.Handler = bb.handler
+	return bb.Service
+}
+
+type bitbucketUser struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	UUID        string `json:"uuid"`
+	Links       struct {
+		Avatar struct {
+			Href string `json:"href"`
+		} `json:"avatar"`
+	} `json:"links"`
+}
+
+type bitbucketEmails struct {
+	Values []struct {
+		Email     string `json:"email"`
+		IsPrimary bool   `json:"is_primary"`
+	} `json:"values"`
+}
+
+// fetchUser combines /2.0/user and /2.0/user/emails into a token.User
+func (b *bitbucketProvider) fetchUser(accessToken string) (token.User, error) {
+	var profile bitbucketUser
+	if err := b.getJSON(bitbucketUserURL, accessToken, &profile); err != nil {
+		return token.User{}, errors.WrapPrefix(err, "can't load bitbucket profile", 0)
+	}
+
+	var emails bitbucketEmails
+	if err := b.getJSON(bitbucketEmailsURL, accessToken, &emails); err != nil {
+		return token.User{}, errors.WrapPrefix(err, "can't load bitbucket emails", 0)
+	}
+
+	email := ""
+	for _, e := range emails.Values {
+		if e.IsPrimary {
+			email = e.Email
+			break
+		}
+	}
+
+	name := profile.DisplayName
+	if name == "" {
+		name = profile.Username
+	}
+
+	return token.User{
+		ID:      "bitbucket_" + profile.UUID,
+		Name:    name,
+		Email:   email,
+		Picture: profile.Links.Avatar.Href,
+	}, nil
+}
+
+func (b *bitbucketProvider) getJSON(url, accessToken string, dst interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// exchangeCode trades an authorization code for an access token via
+// Bitbucket's oauth2 token endpoint, authenticating as the app with HTTP Basic
+// auth (Cid/Csecret) as Bitbucket's docs require.
+func (b *bitbucketProvider) exchangeCode(code string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI(b.Params, b.Name))
+
+	req, err := http.NewRequest("POST", bitbucketTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(b.Cid, b.Csecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", errors.WrapPrefix(err, "token exchange request failed", 0)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("token exchange failed: %s", resp.Status)
+	}
+
+	var tokResp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokResp); err != nil {
+		return "", errors.WrapPrefix(err, "can't decode token response", 0)
+	}
+	return tokResp.AccessToken, nil
+}
+
+// handler is the login/callback pair: with no "code" in the query it redirects
+// to Bitbucket's authorize endpoint with a freshly minted, cookied CSRF state;
+// on callback it verifies state, exchanges the authorization code for an access
+// token, fetches the profile/email pair above, and sets the local JWT+cookie.
+func (b *bitbucketProvider) handler(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		redirectToAuthorize(w, r, b.Params, b.Name, bitbucketAuthURL, "account email")
+		return
+	}
+
+	st, err := popStateCookie(w, r, b.Name)
+	if err != nil {
+		http.Error(w, "invalid state", http.StatusForbidden)
+		return
+	}
+
+	accessToken, err := b.exchangeCode(code)
+	if err != nil {
+		http.Error(w, "code exchange failed", http.StatusForbidden)
+		return
+	}
+
+	u, err := b.fetchUser(accessToken)
+	if err != nil {
+		http.Error(w, "can't load bitbucket user", http.StatusForbidden)
+		return
+	}
+
+	if _, err := b.Params.JwtService.Set(w, token.Claims{User: &u, Provider: b.Name}); err != nil {
+		http.Error(w, "can't set token", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, b.Params.ValidRedirect(st.From), http.StatusFound)
+}
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitbucketProvider_FetchUser(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer tok123", r.Header.Get("Authorization"))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"username":     "jdoe",
+			"display_name": "Jane Doe",
+			"uuid":         "{uuid-1}",
+			"links": map[string]interface{}{
+				"avatar": map[string]string{"href": "http://example.com/avatar.png"},
+			},
+		})
+	})
+	mux.HandleFunc("/emails", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"values": []map[string]interface{}{
+				{"email": "secondary@example.com", "is_primary": false},
+				{"email": "jdoe@example.com", "is_primary": true},
+			},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	origUserURL, origEmailsURL := bitbucketUserURL, bitbucketEmailsURL
+	bitbucketUserURL, bitbucketEmailsURL = srv.URL+"/user", srv.URL+"/emails"
+	defer func() { bitbucketUserURL, bitbucketEmailsURL = origUserURL, origEmailsURL }()
+
+	bb := &bitbucketProvider{client: srv.Client()}
+	u, err := bb.fetchUser("tok123")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bitbucket_{uuid-1}", u.ID)
+	assert.Equal(t, "Jane Doe", u.Name)
+	assert.Equal(t, "jdoe@example.com", u.Email)
+	assert.Equal(t, "http://example.com/avatar.png", u.Picture)
+}
+
+func TestBitbucketProvider_FetchUserFallsBackToUsername(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"username": "jdoe", "uuid": "{uuid-2}"})
+	})
+	mux.HandleFunc("/emails", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"values": []map[string]interface{}{}})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	origUserURL, origEmailsURL := bitbucketUserURL, bitbucketEmailsURL
+	bitbucketUserURL, bitbucketEmailsURL = srv.URL+"/user", srv.URL+"/emails"
+	defer func() { bitbucketUserURL, bitbucketEmailsURL = origUserURL, origEmailsURL }()
+
+	bb := &bitbucketProvider{client: srv.Client()}
+	u, err := bb.fetchUser("tok123")
+	require.NoError(t, err)
+
+	assert.Equal(t, "jdoe", u.Name)
+	assert.Equal(t, "", u.Email)
+}
+
+func TestBitbucketProvider_HandlerRedirectsToAuthorizeWithoutCode(t *testing.T) {
+	p := Params{URL: "https://app.example.com", Cid: "cid"}
+	svc := NewBitbucket(p)
+
+	r := httptest.NewRequest("GET", "/auth/bitbucket/login?from="+url.QueryEscape("https://app.example.com/done"), nil)
+	w := httptest.NewRecorder()
+	svc.Handler(w, r)
+
+	require.Equal(t, http.StatusFound, w.Code)
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "bitbucket.org", loc.Host)
+	assert.Equal(t, "cid", loc.Query().Get("client_id"))
+	assert.Equal(t, "https://app.example.com/auth/bitbucket/callback", loc.Query().Get("redirect_uri"))
+	assert.NotEmpty(t, loc.Query().Get("state"))
+
+	var stateCookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == stateCookieName("bitbucket") {
+			stateCookie = c
+		}
+	}
+	require.NotNil(t, stateCookie, "login leg must set the state cookie")
+}
+
+func TestBitbucketProvider_GetJSONRejectsNonOKStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	bb := &bitbucketProvider{client: srv.Client()}
+	var dst interface{}
+	err := bb.getJSON(srv.URL, "bad-token", &dst)
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Keycloak is a thin wrapper around the generic OIDC provider that also pulls
+// realm and client roles out of the ID token into token.User.Roles.
+type Keycloak struct {
+	*OIDC
+	clientID string
+}
+
+// NewKeycloak makes a Keycloak provider for the given realm, e.g.
+// https://keycloak.example.com/realms/myrealm. clientID selects which
+// resource_access entry's roles are added alongside the realm-wide ones.
+func NewKeycloak(p Params, realmURL string, clientID string) *Keycloak {
+	k := &Keycloak{OIDC: NewOIDC(p, realmURL, []string{"openid", "profile", "email"}), clientID: clientID}
+	k.Name = "keycloak"
+	k.RoleExtractor = k.roles
+	return k
+}
+
+// roles extracts realm_access.roles and resource_access.<clientID>.roles from the
+// raw ID token claims
+func (k *Keycloak) roles(claims jwt.MapClaims) []string {
+	var roles []string
+
+	if realm, ok := claims["realm_access"].(map[string]interface{}); ok {
+		roles = append(roles, stringSlice(realm["roles"])...)
+	}
+
+	if resource, ok := claims["resource_access"].(map[string]interface{}); ok && k.clientID != "" {
+		if client, ok := resource[k.clientID].(map[string]interface{}); ok {
+			roles = append(roles, stringSlice(client["roles"])...)
+		}
+	}
+
+	return roles
+}
+
+func stringSlice(v interface{}) []string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	res := make([]string, 0, len(list))
+	for _, e := range list {
+		if s, ok := e.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
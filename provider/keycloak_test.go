@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeycloak_RolesCombinesRealmAndClientRoles(t *testing.T) {
+	k := NewKeycloak(Params{}, "https://issuer.example.com/realms/myrealm", "myclient")
+
+	claims := jwt.MapClaims{
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"user", "offline_access"},
+		},
+		"resource_access": map[string]interface{}{
+			"myclient": map[string]interface{}{
+				"roles": []interface{}{"editor"},
+			},
+			"other-client": map[string]interface{}{
+				"roles": []interface{}{"ignored"},
+			},
+		},
+	}
+
+	assert.ElementsMatch(t, []string{"user", "offline_access", "editor"}, k.roles(claims))
+}
+
+func TestKeycloak_RolesWithoutResourceAccess(t *testing.T) {
+	k := NewKeycloak(Params{}, "https://issuer.example.com/realms/myrealm", "myclient")
+
+	claims := jwt.MapClaims{
+		"realm_access": map[string]interface{}{"roles": []interface{}{"user"}},
+	}
+	assert.Equal(t, []string{"user"}, k.roles(claims))
+}
+
+func TestKeycloak_RolesMissingClientIDYieldsRealmRolesOnly(t *testing.T) {
+	k := NewKeycloak(Params{}, "https://issuer.example.com/realms/myrealm", "")
+
+	claims := jwt.MapClaims{
+		"realm_access": map[string]interface{}{"roles": []interface{}{"user"}},
+		"resource_access": map[string]interface{}{
+			"myclient": map[string]interface{}{"roles": []interface{}{"editor"}},
+		},
+	}
+	assert.Equal(t, []string{"user"}, k.roles(claims))
+}
+
+func TestKeycloak_RolesNoClaimsPresent(t *testing.T) {
+	k := NewKeycloak(Params{}, "https://issuer.example.com/realms/myrealm", "myclient")
+	assert.Empty(t, k.roles(jwt.MapClaims{}))
+}
@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// stateCookieName stashes the CSRF state (and the post-login redirect target
+// riding alongside it) between a provider's login-initiation redirect and its
+// callback; every provider's Handler shares this one mechanism. It's namespaced
+// per provider so logins with two different providers started close together
+// (e.g. from separate tabs) don't clobber each other's pending state; a second
+// login with the same provider replaces the first one's state.
+func stateCookieName(name string) string {
+	return "AUTH_STATE_" + name
+}
+
+// loginState is what gets round-tripped through stateCookieName: the random
+// CSRF token the provider is expected to echo back as "state", plus the
+// "from"/"site" target the request arrived with, since providers only ever
+// echo back "code" and "state" on their callback, not arbitrary query params.
+type loginState struct {
+	State string
+	From  string
+}
+
+// redirectToAuthorize starts the login leg of the oauth2 dance: it mints a
+// fresh state, cookies it alongside the caller's requested redirect target,
+// and sends the browser off to the provider's authorize endpoint. scope may be
+// empty for providers that don't need one spelled out.
+func redirectToAuthorize(w http.ResponseWriter, r *http.Request, p Params, name, authURL, scope string) {
+	state, err := newState()
+	if err != nil {
+		http.Error(w, "can't make state", http.StatusInternalServerError)
+		return
+	}
+	setStateCookie(w, name, loginState{State: state, From: RedirectQueryParam(r)}, secureCookies(p))
+
+	q := url.Values{}
+	q.Set("client_id", p.Cid)
+	q.Set("redirect_uri", redirectURI(p, name))
+	q.Set("response_type", "code")
+	q.Set("state", state)
+	if scope != "" {
+		q.Set("scope", scope)
+	}
+	http.Redirect(w, r, authURL+"?"+q.Encode(), http.StatusFound)
+}
+
+// redirectURI is the callback URL every provider registers with its app config,
+// assuming the conventional mount point for auth.Service.Handlers' authHandler: "/auth/".
+func redirectURI(p Params, name string) string {
+	return p.URL + "/auth/" + name + "/callback"
+}
+
+// newState returns a fresh random CSRF state value for the oauth2 "state" parameter.
+func newState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// secureCookies reports whether the state cookie should carry Secure, matching
+// whatever the JwtService was configured with for every other cookie it sets.
+func secureCookies(p Params) bool {
+	return p.JwtService != nil && p.JwtService.SecureCookies
+}
+
+// setStateCookie stashes st in a short-lived, HttpOnly cookie named for name.
+func setStateCookie(w http.ResponseWriter, name string, st loginState, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name: stateCookieName(name), Value: st.State + "|" + st.From,
+		HttpOnly: true, Secure: secure, Path: "/", MaxAge: 600,
+	})
+}
+
+// popStateCookie reads back the cookie setStateCookie wrote for name, clears it
+// so it can't be replayed, and checks it against the "state" query parameter
+// the provider's callback came in with.
+func popStateCookie(w http.ResponseWriter, r *http.Request, name string) (loginState, error) {
+	cookie, err := r.Cookie(stateCookieName(name))
+	if err != nil {
+		return loginState{}, errors.Errorf("state cookie missing")
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookieName(name), Value: "", HttpOnly: true, Path: "/", MaxAge: -1})
+
+	parts := strings.SplitN(cookie.Value, "|", 2)
+	st := loginState{State: parts[0]}
+	if len(parts) == 2 {
+		st.From = parts[1]
+	}
+
+	if st.State == "" || st.State != r.URL.Query().Get("state") {
+		return loginState{}, errors.Errorf("state mismatch")
+	}
+	return st, nil
+}
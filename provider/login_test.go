@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+func TestRedirectToAuthorize_StateCookieSecureFollowsJwtService(t *testing.T) {
+	for _, secure := range []bool{true, false} {
+		p := Params{Cid: "cid", JwtService: &token.Service{}}
+		p.JwtService.SecureCookies = secure
+
+		r := httptest.NewRequest("GET", "/github/login", nil)
+		w := httptest.NewRecorder()
+		redirectToAuthorize(w, r, p, "github", "https://example.com/authorize", "")
+
+		var stateCookie *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == stateCookieName("github") {
+				stateCookie = c
+			}
+		}
+		require.NotNil(t, stateCookie)
+		assert.Equal(t, secure, stateCookie.Secure, "secure=%v", secure)
+	}
+}
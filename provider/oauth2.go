@@ -0,0 +1,293 @@
+package provider
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/go-pkgz/rest"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+// oauth2Endpoints is the set of URLs a standard "authorize, then code for
+// access token, then access token for userinfo" oauth2 flow needs beyond
+// Cid/Csecret.
+type oauth2Endpoints struct {
+	authURL  string
+	tokenURL string
+	userURL  string
+	scope    string
+}
+
+// genericHandler is the shared oauth2 handler for the simple providers below.
+// With no "code" in the query it's the login leg: redirect the browser to the
+// provider's authorize endpoint with a freshly minted, cookied CSRF state.
+// Once the provider calls back with "code" and "state", it verifies state,
+// exchanges the code for an access token, loads the userinfo endpoint, maps it
+// to a token.User via mapUser, sets the local JWT+cookie and redirects back to
+// the whitelisted "from" target (ValidRedirect), never the raw query value, so
+// an attacker can't bounce the browser off-site.
+func genericHandler(name string, endpoints oauth2Endpoints, mapUser func([]byte) token.User, p Params) http.HandlerFunc {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.Cid == "" || p.Csecret == "" {
+			rest.RenderJSON(w, r, rest.JSON{"error": name + " not configured"})
+			return
+		}
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			redirectToAuthorize(w, r, p, name, endpoints.authURL, endpoints.scope)
+			return
+		}
+
+		st, err := popStateCookie(w, r, name)
+		if err != nil {
+			http.Error(w, "invalid state", http.StatusForbidden)
+			return
+		}
+
+		accessToken, err := exchangeOAuth2Code(client, endpoints.tokenURL, p.Cid, p.Csecret, code, redirectURI(p, name))
+		if err != nil {
+			http.Error(w, "code exchange failed", http.StatusForbidden)
+			return
+		}
+
+		body, err := fetchOAuth2UserInfo(client, endpoints.userURL, accessToken)
+		if err != nil {
+			http.Error(w, "can't load "+name+" user", http.StatusForbidden)
+			return
+		}
+		u := mapUser(body)
+
+		if _, err := p.JwtService.Set(w, token.Claims{User: &u, Provider: name}); err != nil {
+			http.Error(w, "can't set token", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, p.ValidRedirect(st.From), http.StatusFound)
+	}
+}
+
+// exchangeOAuth2Code trades an authorization code for an access token against
+// a standard oauth2 token endpoint that accepts form-encoded client credentials.
+func exchangeOAuth2Code(client *http.Client, tokenURL, cid, csecret, code, redirectURI string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("client_id", cid)
+	form.Set("client_secret", csecret)
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.WrapPrefix(err, "token exchange request failed", 0)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("token exchange failed: %s", resp.Status)
+	}
+
+	var tokResp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokResp); err != nil {
+		return "", errors.WrapPrefix(err, "can't decode token response", 0)
+	}
+	return tokResp.AccessToken, nil
+}
+
+// fetchOAuth2UserInfo GETs userURL with accessToken and returns the raw body,
+// left to the caller's mapUser to decode since each provider's shape differs.
+func fetchOAuth2UserInfo(client *http.Client, userURL, accessToken string) ([]byte, error) {
+	req, err := http.NewRequest("GET", userURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s from %s", resp.Status, userURL)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// NewGithub makes github oauth2 provider
+func NewGithub(p Params) Service {
+	endpoints := oauth2Endpoints{
+		authURL:  "https://github.com/login/oauth/authorize",
+		tokenURL: "https://github.com/login/oauth/access_token",
+		userURL:  "https://api.github.com/user",
+		scope:    "user:email",
+	}
+	mapUser := func(body []byte) token.User {
+		var u struct {
+			ID        int    `json:"id"`
+			Login     string `json:"login"`
+			Name      string `json:"name"`
+			Email     string `json:"email"`
+			AvatarURL string `json:"avatar_url"`
+		}
+		_ = json.Unmarshal(body, &u)
+		name := u.Name
+		if name == "" {
+			name = u.Login
+		}
+		return token.User{ID: "github_" + u.Login, Name: name, Email: u.Email, Picture: u.AvatarURL}
+	}
+	return Service{Name: "github", Cid: p.Cid, Csecret: p.Csecret, Issuer: p.Issuer, Params: p, Handler: genericHandler("github", endpoints, mapUser, p)}
+}
+
+// NewGoogle makes google oauth2 provider
+func NewGoogle(p Params) Service {
+	endpoints := oauth2Endpoints{
+		authURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL: "https://oauth2.googleapis.com/token",
+		userURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		scope:    "openid profile email",
+	}
+	mapUser := func(body []byte) token.User {
+		var u struct {
+			Sub     string `json:"sub"`
+			Name    string `json:"name"`
+			Email   string `json:"email"`
+			Picture string `json:"picture"`
+		}
+		_ = json.Unmarshal(body, &u)
+		return token.User{ID: "google_" + u.Sub, Name: u.Name, Email: u.Email, Picture: u.Picture}
+	}
+	return Service{Name: "google", Cid: p.Cid, Csecret: p.Csecret, Issuer: p.Issuer, Params: p, Handler: genericHandler("google", endpoints, mapUser, p)}
+}
+
+// NewFacebook makes facebook oauth2 provider
+func NewFacebook(p Params) Service {
+	endpoints := oauth2Endpoints{
+		authURL:  "https://www.facebook.com/v12.0/dialog/oauth",
+		tokenURL: "https://graph.facebook.com/v12.0/oauth/access_token",
+		userURL:  "https://graph.facebook.com/me?fields=id,name,email,picture",
+		scope:    "email public_profile",
+	}
+	mapUser := func(body []byte) token.User {
+		var u struct {
+			ID      string `json:"id"`
+			Name    string `json:"name"`
+			Email   string `json:"email"`
+			Picture struct {
+				Data struct {
+					URL string `json:"url"`
+				} `json:"data"`
+			} `json:"picture"`
+		}
+		_ = json.Unmarshal(body, &u)
+		return token.User{ID: "facebook_" + u.ID, Name: u.Name, Email: u.Email, Picture: u.Picture.Data.URL}
+	}
+	return Service{Name: "facebook", Cid: p.Cid, Csecret: p.Csecret, Issuer: p.Issuer, Params: p, Handler: genericHandler("facebook", endpoints, mapUser, p)}
+}
+
+// NewDev makes the local "dev" provider for testing: it logs in anyone as a
+// fixed "dev" user, but otherwise goes through the same authorize/callback/state
+// dance as a real provider, against the fake IdP DevAuthServer exposes, so
+// integration tests exercise the full login flow rather than a shortcut.
+func NewDev(p Params) Service {
+	client := &http.Client{Timeout: 5 * time.Second}
+	authURL := "http://" + devAuthAddress + "/login/oauth/authorize"
+	tokenURL := "http://" + devAuthAddress + "/login/oauth/access_token"
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			redirectToAuthorize(w, r, p, "dev", authURL, "")
+			return
+		}
+
+		st, err := popStateCookie(w, r, "dev")
+		if err != nil {
+			http.Error(w, "invalid state", http.StatusForbidden)
+			return
+		}
+
+		if _, err := exchangeOAuth2Code(client, tokenURL, p.Cid, p.Csecret, code, redirectURI(p, "dev")); err != nil {
+			http.Error(w, "code exchange failed", http.StatusForbidden)
+			return
+		}
+
+		u := token.User{ID: "dev_user", Name: "dev"}
+		if _, err := p.JwtService.Set(w, token.Claims{User: &u, Provider: "dev"}); err != nil {
+			http.Error(w, "can't set token", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, p.ValidRedirect(st.From), http.StatusFound)
+	}
+	return Service{Name: "dev", Cid: p.Cid, Csecret: p.Csecret, Issuer: p.Issuer, Params: p, Handler: handler}
+}
+
+// devAuthAddress is the default listen address for DevAuthServer.
+const devAuthAddress = "127.0.0.1:8084"
+
+// DevAuthServer is a fake OAuth2 provider for local development and integration
+// tests: it stands in for the "authorize" and "token" endpoints a real provider
+// like github or google would expose, so the full login round trip can be
+// exercised against the "dev" provider without any internet-facing dependency.
+type DevAuthServer struct {
+	Provider  Service
+	Automatic bool // skip the consent screen and approve every authorize request
+
+	httpServer *http.Server
+}
+
+// Run starts the fake provider on devAuthAddress and blocks until Shutdown is
+// called.
+func (d *DevAuthServer) Run() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/authorize", d.authorizeHandler)
+	mux.HandleFunc("/login/oauth/access_token", d.tokenHandler)
+	d.httpServer = &http.Server{Addr: devAuthAddress, Handler: mux}
+	_ = d.httpServer.ListenAndServe()
+}
+
+// Shutdown stops the fake provider server.
+func (d *DevAuthServer) Shutdown() error {
+	if d.httpServer == nil {
+		return nil
+	}
+	return d.httpServer.Close()
+}
+
+// authorizeHandler answers the authorization leg: with Automatic set it redirects
+// straight back to redirect_uri with a fixed code, as if a user had approved the
+// consent screen.
+func (d *DevAuthServer) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	if !d.Automatic {
+		http.Error(w, "interactive dev login not supported", http.StatusNotImplemented)
+		return
+	}
+	redirectURI := r.URL.Query().Get("redirect_uri")
+	state := r.URL.Query().Get("state")
+	http.Redirect(w, r, redirectURI+"?code=devauth_code&state="+state, http.StatusFound)
+}
+
+// tokenHandler answers the code-for-token exchange with a fixed access token.
+func (d *DevAuthServer) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	rest.RenderJSON(w, r, rest.JSON{"access_token": "devauth_token", "token_type": "bearer"})
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+func testJWTService() *token.Service {
+	return token.NewService(token.Opts{
+		SecretReader: token.SecretFunc(func(string) (string, error) { return "secret", nil }),
+	})
+}
+
+// devRoundTrip drives a full login/callback round trip against svc.Handler, the
+// way a browser carrying the AUTH_STATE cookie would: first the login leg (no
+// code), against devAuthAddress's real authorize/token endpoints, then the
+// provider's own callback with the code+state it was sent back.
+func devRoundTrip(t *testing.T, svc Service, query string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	devAuthServer := DevAuthServer{Provider: svc, Automatic: true}
+	go devAuthServer.Run()
+	defer devAuthServer.Shutdown()
+
+	loginReq := httptest.NewRequest("GET", "/dev/login?"+query, nil)
+	loginW := httptest.NewRecorder()
+	svc.Handler(loginW, loginReq)
+	require.Equal(t, http.StatusFound, loginW.Code)
+	authorizeURL := loginW.Header().Get("Location")
+
+	var stateCookie *http.Cookie
+	for _, c := range loginW.Result().Cookies() {
+		if c.Name == stateCookieName("dev") {
+			stateCookie = c
+		}
+	}
+	require.NotNil(t, stateCookie, "login leg must set the state cookie")
+
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ { // devAuthServer.Run() just started in a goroutine above; give it a moment to bind
+		resp, err = noFollow.Get(authorizeURL)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	callbackURL := resp.Header.Get("Location")
+	require.True(t, strings.Contains(callbackURL, "/dev/"), "devAuthServer must redirect back to the dev callback, got %q", callbackURL)
+
+	u, err := url.Parse(callbackURL)
+	require.NoError(t, err)
+
+	callbackReq := httptest.NewRequest("GET", u.RequestURI(), nil)
+	callbackReq.AddCookie(stateCookie)
+	callbackW := httptest.NewRecorder()
+	svc.Handler(callbackW, callbackReq)
+	return callbackW
+}
+
+func TestNewDev_HandlerRedirectsThroughWhitelist(t *testing.T) {
+	p := Params{URL: "https://fallback.example.com", JwtService: testJWTService(), AllowedRedirectDomains: []string{"example.com"}}
+	svc := NewDev(p)
+
+	w := devRoundTrip(t, svc, "from="+url.QueryEscape("https://example.com/done"))
+
+	assert.Equal(t, "https://example.com/done", w.Header().Get("Location"))
+}
+
+func TestNewDev_HandlerRejectsOffWhitelistRedirect(t *testing.T) {
+	p := Params{URL: "https://fallback.example.com", JwtService: testJWTService(), AllowedRedirectDomains: []string{"example.com"}}
+	svc := NewDev(p)
+
+	w := devRoundTrip(t, svc, "from="+url.QueryEscape("https://evil.com/done"))
+
+	assert.Equal(t, "https://fallback.example.com", w.Header().Get("Location"))
+}
+
+func TestGenericHandler_NotConfigured(t *testing.T) {
+	p := Params{JwtService: testJWTService()}
+	svc := NewGithub(p)
+
+	r := httptest.NewRequest("GET", "/github/callback?code=abc", nil)
+	w := httptest.NewRecorder()
+	svc.Handler(w, r)
+
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "not configured")
+}
@@ -0,0 +1,322 @@
+package provider
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-errors/errors"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+// openIDConfig is the subset of the issuer's discovery document we care about
+type openIDConfig struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// OIDC is a generic OpenID Connect provider. Unlike the fixed oauth2 providers it
+// discovers its token and keys endpoints from the issuer's
+// .well-known/openid-configuration document instead of hard-coding them.
+type OIDC struct {
+	Service
+
+	issuerURL string
+	scopes    []string
+	client    *http.Client
+
+	discoverMu sync.Mutex
+	discovered bool
+	config     openIDConfig
+	keys       map[string]*rsa.PublicKey
+
+	// RoleExtractor, when set, pulls extra authorization info (e.g. Keycloak's
+	// realm/client roles) out of the raw ID token claims into token.User.Roles.
+	RoleExtractor func(claims jwt.MapClaims) []string
+}
+
+// NewOIDC makes a generic OpenID Connect provider for the given issuer. Discovery
+// happens lazily, on first use, so AddProvider itself never fails on network errors.
+func NewOIDC(p Params, issuerURL string, scopes []string) *OIDC {
+	o := &OIDC{
+		issuerURL: strings.TrimSuffix(issuerURL, "/"),
+		scopes:    scopes,
+		client:    &http.Client{Timeout: 5 * time.Second},
+	}
+	o.Name = "oidc"
+	o.Cid = p.Cid
+	o.Csecret = p.Csecret
+	o.Issuer = p.Issuer
+	o.Params = p
+	o.Handler = o.handler
+	o.Service.Refresh = o.refresh
+	return o
+}
+
+// discover fetches and caches the issuer's configuration and signing keys. It
+// only caches on success, so a transient failure (network blip, issuer down
+// for a moment) doesn't poison the provider for the rest of the process's
+// life the way a sync.Once guarding the whole body would.
+func (o *OIDC) discover() error {
+	o.discoverMu.Lock()
+	defer o.discoverMu.Unlock()
+
+	if o.discovered {
+		return nil
+	}
+
+	resp, err := o.client.Get(o.issuerURL + "/.well-known/openid-configuration")
+	if err != nil {
+		return errors.WrapPrefix(err, "can't reach discovery endpoint", 0)
+	}
+	defer resp.Body.Close()
+
+	var cfg openIDConfig
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return errors.WrapPrefix(err, "can't decode discovery document", 0)
+	}
+
+	keys, err := o.fetchKeys(cfg.JWKSURI)
+	if err != nil {
+		return err
+	}
+
+	o.config, o.keys, o.discovered = cfg, keys, true
+	return nil
+}
+
+func (o *OIDC) fetchKeys(jwksURI string) (map[string]*rsa.PublicKey, error) {
+	resp, err := o.client.Get(jwksURI)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "can't fetch jwks", 0)
+	}
+	defer resp.Body.Close()
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, errors.WrapPrefix(err, "can't decode jwks", 0)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		pub, err := rsaPublicKey(k.N, k.E)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "can't parse jwk", 0)
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func rsaPublicKey(nStr, eStr string) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(nStr)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(eStr)
+	if err != nil {
+		return nil, err
+	}
+	exp := 0
+	for _, b := range e {
+		exp = exp<<8 + int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+}
+
+// verifyIDToken checks the id_token's signature against the issuer's JWKS as well
+// as its issuer and expiration, returning the raw claims so mapUser (and
+// RoleExtractor) can pull provider-specific fields out of them.
+func (o *OIDC) verifyIDToken(idToken string) (jwt.MapClaims, error) {
+	if err := o.discover(); err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := o.keys[kid]
+		if !ok {
+			return nil, errors.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "id token verification failed", 0)
+	}
+	if iss, _ := claims["iss"].(string); iss != o.issuerURL {
+		return nil, errors.Errorf("unexpected issuer %q", iss)
+	}
+	if !hasAudience(claims["aud"], o.Cid) {
+		return nil, errors.Errorf("unexpected audience")
+	}
+	return claims, nil
+}
+
+// hasAudience reports whether aud, the raw "aud" claim, contains cid. Per OIDC
+// core 3.1.3.7 the claim may be a single string or a JSON array of strings.
+func hasAudience(aud interface{}, cid string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == cid
+	case []interface{}:
+		for _, e := range v {
+			if s, ok := e.(string); ok && s == cid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mapUser maps the verified ID token claims into token.User
+func (o *OIDC) mapUser(claims jwt.MapClaims) token.User {
+	sub, _ := claims["sub"].(string)
+	name, _ := claims["preferred_username"].(string)
+	if name == "" {
+		name = sub
+	}
+	email, _ := claims["email"].(string)
+	picture, _ := claims["picture"].(string)
+
+	u := token.User{ID: "oidc_" + sub, Name: name, Email: email, Picture: picture}
+	if o.RoleExtractor != nil {
+		u.Roles = o.RoleExtractor(claims)
+	}
+	return u
+}
+
+// refresh exchanges refreshToken for a new id_token via the issuer's token
+// endpoint, re-validates it and returns the updated user and refresh token.
+func (o *OIDC) refresh(refreshToken string) (token.User, string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+
+	tokResp, err := o.exchange(form)
+	if err != nil {
+		return token.User{}, "", errors.WrapPrefix(err, "refresh token exchange failed", 0)
+	}
+
+	claims, err := o.verifyIDToken(tokResp.IDToken)
+	if err != nil {
+		return token.User{}, "", err
+	}
+
+	newRefreshToken := tokResp.RefreshToken
+	if newRefreshToken == "" {
+		newRefreshToken = refreshToken // issuer may not rotate it on every refresh
+	}
+	return o.mapUser(claims), newRefreshToken, nil
+}
+
+// tokenResponse is the subset of the token endpoint's response both the initial
+// code exchange and the refresh exchange care about.
+type tokenResponse struct {
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// exchange posts form to the issuer's token endpoint and decodes the response,
+// used by both the login callback (authorization_code) and refresh (refresh_token).
+func (o *OIDC) exchange(form url.Values) (tokenResponse, error) {
+	if err := o.discover(); err != nil {
+		return tokenResponse{}, err
+	}
+
+	form.Set("client_id", o.Cid)
+	form.Set("client_secret", o.Csecret)
+
+	resp, err := o.client.PostForm(o.config.TokenEndpoint, form)
+	if err != nil {
+		return tokenResponse{}, errors.WrapPrefix(err, "token request failed", 0)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return tokenResponse{}, errors.Errorf("token request failed: %s, %s", resp.Status, body)
+	}
+
+	var tokResp tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokResp); err != nil {
+		return tokenResponse{}, errors.WrapPrefix(err, "can't decode token response", 0)
+	}
+	return tokResp, nil
+}
+
+// handler is the oauth2-style login/callback pair, same as genericHandler: with
+// no "code" in the query it redirects to the issuer's discovered authorize
+// endpoint with a freshly minted, cookied CSRF state; once the issuer calls
+// back it verifies state, exchanges the code for an id_token, verifies that,
+// sets the local JWT+cookie and redirects back to the whitelisted "from"
+// target (or Params.URL if none/not whitelisted).
+func (o *OIDC) handler(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		if err := o.discover(); err != nil {
+			http.Error(w, "discovery failed", http.StatusServiceUnavailable)
+			return
+		}
+		redirectToAuthorize(w, r, o.Params, o.Name, o.config.AuthorizationEndpoint, strings.Join(o.scopes, " "))
+		return
+	}
+
+	st, err := popStateCookie(w, r, o.Name)
+	if err != nil {
+		http.Error(w, "invalid state", http.StatusForbidden)
+		return
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI(o.Params, o.Name))
+
+	tokResp, err := o.exchange(form)
+	if err != nil {
+		http.Error(w, "code exchange failed", http.StatusForbidden)
+		return
+	}
+
+	claims, err := o.verifyIDToken(tokResp.IDToken)
+	if err != nil {
+		http.Error(w, "id token verification failed", http.StatusForbidden)
+		return
+	}
+	u := o.mapUser(claims)
+
+	if _, err := o.Params.JwtService.Set(w, token.Claims{
+		User:         &u,
+		RefreshToken: tokResp.RefreshToken,
+		Provider:     o.Name,
+		IDToken:      tokResp.IDToken,
+	}); err != nil {
+		http.Error(w, "can't set token", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, o.Params.ValidRedirect(st.From), http.StatusFound)
+}
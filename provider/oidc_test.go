@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestOIDCServer serves a minimal .well-known/openid-configuration, jwks and
+// token endpoint backed by key, so verifyIDToken/refresh can run against a real
+// (if fake) issuer instead of mocking *OIDC's internals directly.
+func newTestOIDCServer(t *testing.T, key *rsa.PrivateKey, kid string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	var issuer string
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"token_endpoint": issuer + "/token",
+			"jwks_uri":       issuer + "/keys",
+		})
+	})
+
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		n := base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes())
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{"kty": "RSA", "kid": kid, "n": n, "e": e}},
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idToken := signIDToken(t, key, kid, issuer, jwt.MapClaims{
+			"sub": "u1", "email": "u1@example.com", "preferred_username": "user-one", "aud": "cid",
+		})
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "refresh_token": "new-refresh"})
+	})
+
+	srv := httptest.NewServer(mux)
+	issuer = srv.URL
+	return srv
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid, issuer string, extra jwt.MapClaims) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{"iss": issuer, "sub": "u1"}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	tkn := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tkn.Header["kid"] = kid
+	s, err := tkn.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestOIDC_VerifyIDTokenAndMapUser(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := newTestOIDCServer(t, key, "kid1")
+	defer srv.Close()
+
+	o := NewOIDC(Params{Cid: "cid", Csecret: "secret"}, srv.URL, []string{"openid"})
+
+	idToken := signIDToken(t, key, "kid1", srv.URL, jwt.MapClaims{
+		"sub": "u1", "email": "u1@example.com", "preferred_username": "user-one", "picture": "http://example.com/pic.png", "aud": "cid",
+	})
+
+	claims, err := o.verifyIDToken(idToken)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", claims["sub"])
+
+	u := o.mapUser(claims)
+	assert.Equal(t, "oidc_u1", u.ID)
+	assert.Equal(t, "user-one", u.Name)
+	assert.Equal(t, "u1@example.com", u.Email)
+	assert.Equal(t, "http://example.com/pic.png", u.Picture)
+}
+
+func TestOIDC_MapUserFallsBackToSubWhenNoUsername(t *testing.T) {
+	o := NewOIDC(Params{}, "https://issuer.example.com", []string{"openid"})
+	u := o.mapUser(jwt.MapClaims{"sub": "u2"})
+	assert.Equal(t, "oidc_u2", u.ID)
+	assert.Equal(t, "u2", u.Name)
+}
+
+func TestOIDC_VerifyIDTokenRejectsWrongIssuer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := newTestOIDCServer(t, key, "kid1")
+	defer srv.Close()
+
+	o := NewOIDC(Params{}, srv.URL, []string{"openid"})
+
+	idToken := signIDToken(t, key, "kid1", "https://not-the-issuer.example.com", jwt.MapClaims{"sub": "u1"})
+	_, err = o.verifyIDToken(idToken)
+	assert.Error(t, err)
+}
+
+func TestOIDC_DiscoverCachesEvenWithoutTokenEndpoint(t *testing.T) {
+	var discoveryHits int
+	mux := http.NewServeMux()
+	var issuer string
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		discoveryHits++
+		_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuer + "/keys"}) // no token_endpoint
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{}})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	issuer = srv.URL
+
+	o := NewOIDC(Params{}, srv.URL, []string{"openid"})
+
+	require.NoError(t, o.discover())
+	require.NoError(t, o.discover())
+	assert.Equal(t, 1, discoveryHits, "a second discover() call must be served from cache, not re-fetched")
+}
+
+func TestOIDC_VerifyIDTokenRejectsWrongAudience(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := newTestOIDCServer(t, key, "kid1")
+	defer srv.Close()
+
+	o := NewOIDC(Params{Cid: "cid"}, srv.URL, []string{"openid"})
+
+	idToken := signIDToken(t, key, "kid1", srv.URL, jwt.MapClaims{"sub": "u1", "aud": "someone-else"})
+	_, err = o.verifyIDToken(idToken)
+	assert.Error(t, err)
+}
+
+func TestOIDC_VerifyIDTokenAcceptsAudienceArray(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := newTestOIDCServer(t, key, "kid1")
+	defer srv.Close()
+
+	o := NewOIDC(Params{Cid: "cid"}, srv.URL, []string{"openid"})
+
+	idToken := signIDToken(t, key, "kid1", srv.URL, jwt.MapClaims{"sub": "u1", "aud": []string{"other", "cid"}})
+	_, err = o.verifyIDToken(idToken)
+	assert.NoError(t, err)
+}
+
+func TestOIDC_VerifyIDTokenRejectsUnknownKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := newTestOIDCServer(t, key, "kid1")
+	defer srv.Close()
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	o := NewOIDC(Params{}, srv.URL, []string{"openid"})
+	idToken := signIDToken(t, other, "kid-unknown", srv.URL, jwt.MapClaims{"sub": "u1"})
+	_, err = o.verifyIDToken(idToken)
+	assert.Error(t, err)
+}
+
+func TestOIDC_Refresh(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := newTestOIDCServer(t, key, "kid1")
+	defer srv.Close()
+
+	o := NewOIDC(Params{Cid: "cid", Csecret: "secret"}, srv.URL, []string{"openid"})
+	u, newRefresh, err := o.refresh("old-refresh")
+	require.NoError(t, err)
+	assert.Equal(t, "oidc_u1", u.ID)
+	assert.Equal(t, "new-refresh", newRefresh)
+}
@@ -0,0 +1,61 @@
+// Package provider implements the oauth2 and local login providers used by the
+// top-level auth.Service.
+package provider
+
+import (
+	"net/http"
+
+	"github.com/go-pkgz/auth/avatar"
+	"github.com/go-pkgz/auth/token"
+)
+
+// Params is a common set of parameters every provider constructor needs
+type Params struct {
+	URL         string
+	JwtService  *token.Service
+	Issuer      string
+	AvatarProxy *avatar.Proxy
+	Cid         string
+	Csecret     string
+
+	// AllowedRedirectDomains whitelists hosts the post-login "from"/"site" query
+	// parameter is allowed to send the browser to (see ValidRedirect); empty means
+	// every request falls back to URL.
+	AllowedRedirectDomains []string
+}
+
+// ValidRedirect returns from if it's a non-empty, whitelisted redirect target per
+// AllowedRedirectDomains, or p.URL otherwise. Every provider's callback handler
+// funnels its post-login redirect through this to avoid being an open-redirect sink.
+func (p Params) ValidRedirect(from string) string {
+	if IsValidRedirect(from, p.AllowedRedirectDomains) {
+		return from
+	}
+	return p.URL
+}
+
+// RedirectQueryParam reads the post-login redirect target off r, accepting
+// either the "from" or the older "site" query parameter name.
+func RedirectQueryParam(r *http.Request) string {
+	q := r.URL.Query()
+	if from := q.Get("from"); from != "" {
+		return from
+	}
+	return q.Get("site")
+}
+
+// Service represents a single auth provider, github, google, etc.
+// It is a plain struct rather than an interface so it can carry the oauth2
+// config alongside the name without every provider needing its own type.
+type Service struct {
+	Name    string
+	Cid     string
+	Csecret string
+	Issuer  string
+	Params  Params
+	Handler http.HandlerFunc
+
+	// Refresh exchanges a refresh token for a fresh user and refresh token
+	// without involving the browser. nil for providers that don't support it.
+	Refresh func(refreshToken string) (token.User, string, error)
+}
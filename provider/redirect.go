@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"net/url"
+	"strings"
+)
+
+// IsValidRedirect reports whether redirectURL is safe to send the browser to: an
+// absolute http(s) URL whose host either exactly matches one of allowed, or falls
+// under a ".example.com"-style wildcard entry (matching example.com itself and any
+// subdomain of it).
+func IsValidRedirect(redirectURL string, allowed []string) bool {
+	if redirectURL == "" {
+		return false
+	}
+
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	host := u.Hostname()
+	for _, a := range allowed {
+		if strings.HasPrefix(a, ".") {
+			base := strings.TrimPrefix(a, ".")
+			if strings.EqualFold(host, base) || strings.HasSuffix(strings.ToLower(host), strings.ToLower(a)) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(host, a) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidRedirect(t *testing.T) {
+	allowed := []string{"example.com", ".sub.example.com"}
+
+	tbl := []struct {
+		name string
+		url  string
+		ok   bool
+	}{
+		{"exact host", "https://example.com/done", true},
+		{"wildcard host", "https://foo.sub.example.com/done", true},
+		{"wildcard apex", "https://sub.example.com/done", true},
+		{"different host", "https://evil.com/done", false},
+		{"suffix-but-not-subdomain host", "https://notexample.com/done", false},
+		{"no scheme", "example.com/done", false},
+		{"javascript scheme", "javascript:alert(1)", false},
+		{"ftp scheme", "ftp://example.com/done", false},
+		{"ip literal, not whitelisted", "http://127.0.0.1/done", false},
+		{"punycode host, not whitelisted", "https://xn--80ak6aa92e.com/done", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.ok, IsValidRedirect(tt.url, allowed))
+		})
+	}
+}
+
+func TestIsValidRedirectIPLiteralWhitelisted(t *testing.T) {
+	assert.True(t, IsValidRedirect("http://127.0.0.1/done", []string{"127.0.0.1"}))
+}
+
+func TestParams_ValidRedirect(t *testing.T) {
+	p := Params{URL: "https://fallback.example.com", AllowedRedirectDomains: []string{"example.com"}}
+
+	assert.Equal(t, "https://example.com/done", p.ValidRedirect("https://example.com/done"))
+	assert.Equal(t, "https://fallback.example.com", p.ValidRedirect("https://evil.com/done"))
+	assert.Equal(t, "https://fallback.example.com", p.ValidRedirect(""))
+}
@@ -0,0 +1,19 @@
+package token
+
+// SessionStore persists Claims server-side so the JWT cookie can carry just an
+// opaque, HMAC-signed session id instead of the full claims. This sidesteps the
+// cookie-size problem for rich claims entirely and, unlike a stateless JWT,
+// supports true logout and admin-forced revocation.
+type SessionStore interface {
+	Save(id string, claims Claims) error
+	Load(id string) (Claims, error)
+	Delete(id string) error
+}
+
+// SessionLister is implemented by SessionStore backends that can enumerate their
+// active sessions, used by the /auth/sessions admin endpoint. Not every backend
+// needs to support it, hence the separate interface rather than folding List into
+// SessionStore itself.
+type SessionLister interface {
+	List() ([]string, error)
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-errors/errors"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+// FS is a token.SessionStore persisting each session as one JSON file under a base
+// directory, for single-instance deployments that want sessions to survive a restart.
+type FS struct {
+	basePath string
+}
+
+// NewFS makes a filesystem-backed SessionStore rooted at basePath, which must
+// already exist and be writable.
+func NewFS(basePath string) *FS {
+	return &FS{basePath: basePath}
+}
+
+func (f *FS) path(id string) string {
+	return filepath.Join(f.basePath, id+".json")
+}
+
+// validSessionID rejects empty ids, ids equal to "." or "..", and ids carrying a
+// path separator, which would otherwise let Save/Load/Delete escape basePath via f.path.
+func validSessionID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\`) && id != ".." && id != "."
+}
+
+// Save claims under id, overwriting any previous session with the same id
+func (f *FS) Save(id string, claims token.Claims) error {
+	if !validSessionID(id) {
+		return errors.Errorf("invalid session id %q", id)
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return errors.WrapPrefix(err, "can't encode claims", 0)
+	}
+	if err := os.WriteFile(f.path(id), data, 0600); err != nil {
+		return errors.WrapPrefix(err, "can't write session file", 0)
+	}
+	return nil
+}
+
+// Load claims previously saved under id
+func (f *FS) Load(id string) (token.Claims, error) {
+	if !validSessionID(id) {
+		return token.Claims{}, errors.Errorf("invalid session id %q", id)
+	}
+	data, err := os.ReadFile(f.path(id))
+	if err != nil {
+		return token.Claims{}, errors.WrapPrefix(err, "session not found", 0)
+	}
+	var claims token.Claims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return token.Claims{}, errors.WrapPrefix(err, "can't decode claims", 0)
+	}
+	return claims, nil
+}
+
+// Delete the session saved under id, if any
+func (f *FS) Delete(id string) error {
+	if !validSessionID(id) {
+		return errors.Errorf("invalid session id %q", id)
+	}
+	if err := os.Remove(f.path(id)); err != nil && !os.IsNotExist(err) {
+		return errors.WrapPrefix(err, "can't delete session file", 0)
+	}
+	return nil
+}
+
+// List returns the ids of all active sessions
+func (f *FS) List() ([]string, error) {
+	entries, err := os.ReadDir(f.basePath)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "can't list session directory", 0)
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".json" {
+			ids = append(ids, strings.TrimSuffix(e.Name(), ".json"))
+		}
+	}
+	return ids, nil
+}
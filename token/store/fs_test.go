@@ -0,0 +1,38 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+func TestFS_SaveLoadDelete(t *testing.T) {
+	fs := NewFS(t.TempDir())
+	claims := token.Claims{User: &token.User{ID: "id1"}}
+
+	require.NoError(t, fs.Save("sess1", claims))
+
+	loaded, err := fs.Load("sess1")
+	require.NoError(t, err)
+	assert.Equal(t, "id1", loaded.User.ID)
+
+	require.NoError(t, fs.Delete("sess1"))
+	_, err = fs.Load("sess1")
+	assert.Error(t, err)
+}
+
+func TestFS_RejectsPathTraversalID(t *testing.T) {
+	dir := t.TempDir()
+	fs := NewFS(dir)
+	claims := token.Claims{User: &token.User{ID: "id1"}}
+
+	for _, id := range []string{"../escaped", "a/../../escaped", "/etc/passwd", "..", "."} {
+		assert.Error(t, fs.Save(id, claims), "id %q", id)
+		_, err := fs.Load(id)
+		assert.Error(t, err, "id %q", id)
+		assert.Error(t, fs.Delete(id), "id %q", id)
+	}
+}
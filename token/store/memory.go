@@ -0,0 +1,62 @@
+// Package store provides token.SessionStore implementations: an in-memory store
+// for tests and single-process deployments, a filesystem store for single-instance
+// deployments that want sessions to survive a restart, and a Redis store for
+// multi-instance ones.
+package store
+
+import (
+	"sync"
+
+	"github.com/go-errors/errors"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+// Memory is an in-process, non-persistent token.SessionStore
+type Memory struct {
+	mu   sync.RWMutex
+	data map[string]token.Claims
+}
+
+// NewMemory makes an empty in-memory SessionStore
+func NewMemory() *Memory {
+	return &Memory{data: map[string]token.Claims{}}
+}
+
+// Save claims under id, overwriting any previous session with the same id
+func (m *Memory) Save(id string, claims token.Claims) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[id] = claims
+	return nil
+}
+
+// Load claims previously saved under id
+func (m *Memory) Load(id string) (token.Claims, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	claims, ok := m.data[id]
+	if !ok {
+		return token.Claims{}, errors.Errorf("session %s not found", id)
+	}
+	return claims, nil
+}
+
+// Delete the session saved under id, if any
+func (m *Memory) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, id)
+	return nil
+}
+
+// List returns the ids of all active sessions
+func (m *Memory) List() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]string, 0, len(m.data))
+	for id := range m.data {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/go-pkgz/auth/token"
+)
+
+// Redis is a token.SessionStore backed by a Redis instance, for multi-instance
+// deployments that need a session store shared across all of them.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedis makes a Redis-backed SessionStore. ttl bounds how long a session
+// survives without being re-saved; zero means sessions never expire on their own.
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{client: client, prefix: "auth:session:", ttl: ttl}
+}
+
+// Save claims under id, overwriting any previous session with the same id
+func (r *Redis) Save(id string, claims token.Claims) error {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return errors.WrapPrefix(err, "can't encode claims", 0)
+	}
+	if err := r.client.Set(context.Background(), r.prefix+id, data, r.ttl).Err(); err != nil {
+		return errors.WrapPrefix(err, "can't save session", 0)
+	}
+	return nil
+}
+
+// Load claims previously saved under id
+func (r *Redis) Load(id string) (token.Claims, error) {
+	data, err := r.client.Get(context.Background(), r.prefix+id).Bytes()
+	if err != nil {
+		return token.Claims{}, errors.WrapPrefix(err, "session not found", 0)
+	}
+	var claims token.Claims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return token.Claims{}, errors.WrapPrefix(err, "can't decode claims", 0)
+	}
+	return claims, nil
+}
+
+// Delete the session saved under id, if any
+func (r *Redis) Delete(id string) error {
+	if err := r.client.Del(context.Background(), r.prefix+id).Err(); err != nil {
+		return errors.WrapPrefix(err, "can't delete session", 0)
+	}
+	return nil
+}
+
+// List returns the ids of all active sessions
+func (r *Redis) List() ([]string, error) {
+	keys, err := r.client.Keys(context.Background(), r.prefix+"*").Result()
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "can't list sessions", 0)
+	}
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = strings.TrimPrefix(k, r.prefix)
+	}
+	return ids, nil
+}
@@ -0,0 +1,408 @@
+// Package token provides jwt encoding/decoding for auth tokens as well as the User
+// and Claims types used across the library.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-errors/errors"
+)
+
+// defaultMaxCookieSize is the JWT cookie chunking threshold used when
+// Opts.MaxCookieSize is left at zero, comfortably under the ~4KB per-cookie
+// limit most browsers enforce.
+const defaultMaxCookieSize = 3800
+
+// User is the remote user info, populated by a provider from the claims it gets back
+type User struct {
+	Name       string                 `json:"name"`
+	ID         string                 `json:"id"`
+	Picture    string                 `json:"picture"`
+	IP         string                 `json:"ip,omitempty"`
+	Email      string                 `json:"email,omitempty"`
+	Roles      []string               `json:"roles,omitempty"`
+	Attributes map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// Claims stores user info for the JWT and implements jwt.Claims
+type Claims struct {
+	jwt.StandardClaims
+	User        *User `json:"user,omitempty"`
+	SessionOnly bool  `json:"sess_only,omitempty"`
+	// RefreshToken holds the provider's OAuth2/OIDC refresh token, when available,
+	// so Authenticator can mint a new JWT without forcing the user to log in again.
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Provider records which provider issued RefreshToken, so Authenticator knows
+	// where to exchange it once the JWT expires.
+	Provider string `json:"provider,omitempty"`
+	// IDToken is the provider's raw OIDC id_token, kept around so Authenticator can
+	// hand it to reverse-proxied backends via PassAuthHeaderUpstream.
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// Secret defines interface returning secret for given site id (aud)
+type Secret interface {
+	Get(aud string) (string, error)
+}
+
+// SecretFunc type is an adapter to allow the use of ordinary functions as Secret
+type SecretFunc func(aud string) (string, error)
+
+// Get calls f(aud)
+func (f SecretFunc) Get(aud string) (string, error) { return f(aud) }
+
+// ClaimsUpdater defines interface adding extras to claims
+type ClaimsUpdater interface {
+	Update(claims Claims) Claims
+}
+
+// Opts holds all the options for the Service
+type Opts struct {
+	SecretReader   Secret
+	ClaimsUpd      ClaimsUpdater
+	SecureCookies  bool
+	TokenDuration  time.Duration
+	CookieDuration time.Duration
+	DisableXSRF    bool
+
+	JWTCookieName  string
+	JWTHeaderKey   string
+	XSRFCookieName string
+	XSRFHeaderKey  string
+
+	Issuer string
+
+	// AuthHeaderEnabled makes Get also accept a standard "Authorization: Bearer
+	// <jwt>" header, in addition to the cookie and the custom JWTHeaderKey header.
+	// A token read this way is treated like the JWTHeaderKey case: no XSRF check,
+	// since there's no cookie to protect.
+	AuthHeaderEnabled bool
+
+	// MaxCookieSize is the largest a single JWT cookie is allowed to get before
+	// Set splits it across JWT_0, JWT_1, ... cookies instead. Zero uses defaultMaxCookieSize.
+	MaxCookieSize int
+
+	// SessionStore, if set, switches Set/Get to server-side sessions: the cookie
+	// carries only an opaque, HMAC-signed session id and the full Claims are kept
+	// in the store instead, enabling true logout and admin-forced revocation.
+	SessionStore SessionStore
+}
+
+// Service wraps jwt encoding/decoding as well as the cookie get/set logic
+type Service struct {
+	Opts
+}
+
+// NewService makes JWT Service with given options applying the usual defaults
+func NewService(opts Opts) *Service {
+	if opts.JWTCookieName == "" {
+		opts.JWTCookieName = "JWT"
+	}
+	if opts.JWTHeaderKey == "" {
+		opts.JWTHeaderKey = "X-JWT"
+	}
+	if opts.XSRFCookieName == "" {
+		opts.XSRFCookieName = "XSRF-TOKEN"
+	}
+	if opts.XSRFHeaderKey == "" {
+		opts.XSRFHeaderKey = "X-XSRF-TOKEN"
+	}
+	if opts.Issuer == "" {
+		opts.Issuer = "go-pkgz/auth"
+	}
+	return &Service{Opts: opts}
+}
+
+// Token makes token with claims
+func (j *Service) Token(claims Claims) (string, error) {
+	claims.Issuer = j.Issuer
+	if claims.ExpiresAt == 0 && j.TokenDuration > 0 {
+		claims.IssuedAt = time.Now().Unix()
+		claims.ExpiresAt = time.Now().Add(j.TokenDuration).Unix()
+	}
+	tkn := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	secret, err := j.secret(claims.Audience)
+	if err != nil {
+		return "", errors.WrapPrefix(err, "can't get secret", 0)
+	}
+	return tkn.SignedString([]byte(secret))
+}
+
+// Parse token string and verify signature, issuer and expiration. The returned
+// claims are populated even when err is a plain expiration error, so callers can
+// still inspect them (see IsExpired) to drive a refresh.
+func (j *Service) Parse(tokenStr string) (Claims, error) {
+	parser := jwt.Parser{}
+	claims := Claims{}
+	_, err := parser.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+		secret, e := j.secret(claims.Audience)
+		if e != nil {
+			return nil, e
+		}
+		return []byte(secret), nil
+	})
+	if (err == nil || IsExpired(err)) && claims.Issuer != j.Issuer {
+		return claims, errors.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	return claims, err
+}
+
+// IsExpired reports whether err, as returned from Parse or Get, indicates an
+// expired (but otherwise validly signed) token rather than a malformed or forged one.
+func IsExpired(err error) bool {
+	verr, ok := err.(*jwt.ValidationError)
+	return ok && verr.Errors == jwt.ValidationErrorExpired
+}
+
+func (j *Service) secret(aud string) (string, error) {
+	if j.SecretReader == nil {
+		return "", errors.New("SecretReader not defined")
+	}
+	return j.SecretReader.Get(aud)
+}
+
+// Set makes token from claims and sets it as a cookie (or, if it's too large,
+// several numbered chunk cookies) as well as the matching XSRF cookie. With
+// SessionStore configured, it instead saves claims server-side and cookies only
+// the opaque session id.
+func (j *Service) Set(w http.ResponseWriter, claims Claims) (Claims, error) {
+	if j.SessionStore != nil {
+		return j.setSession(w, claims)
+	}
+
+	if claims.Id == "" {
+		id, err := newSessionID()
+		if err != nil {
+			return Claims{}, errors.WrapPrefix(err, "can't make xsrf id", 0)
+		}
+		claims.Id = id
+	}
+
+	tokenStr, err := j.Token(claims)
+	if err != nil {
+		return Claims{}, errors.WrapPrefix(err, "can't make token", 0)
+	}
+
+	cookieExpiration := 0
+	if !claims.SessionOnly {
+		cookieExpiration = int(j.CookieDuration.Seconds())
+	}
+
+	j.setJWTCookie(w, tokenStr, cookieExpiration)
+
+	if !j.DisableXSRF {
+		xsrfCookie := http.Cookie{Name: j.XSRFCookieName, Value: claims.Id, HttpOnly: false, Path: "/",
+			MaxAge: cookieExpiration, Secure: j.SecureCookies}
+		http.SetCookie(w, &xsrfCookie)
+	}
+
+	return claims, nil
+}
+
+// setSession saves claims under a fresh session id and cookies only the opaque,
+// signed id, instead of the full JWT
+func (j *Service) setSession(w http.ResponseWriter, claims Claims) (Claims, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return Claims{}, errors.WrapPrefix(err, "can't make session id", 0)
+	}
+	if claims.Id == "" {
+		claims.Id = id
+	}
+
+	if err := j.SessionStore.Save(id, claims); err != nil {
+		return Claims{}, errors.WrapPrefix(err, "can't save session", 0)
+	}
+
+	cookieVal, err := j.signSessionID(id)
+	if err != nil {
+		return Claims{}, errors.WrapPrefix(err, "can't sign session cookie", 0)
+	}
+
+	cookieExpiration := 0
+	if !claims.SessionOnly {
+		cookieExpiration = int(j.CookieDuration.Seconds())
+	}
+	j.setJWTCookie(w, cookieVal, cookieExpiration)
+
+	if !j.DisableXSRF {
+		xsrfCookie := http.Cookie{Name: j.XSRFCookieName, Value: claims.Id, HttpOnly: false, Path: "/",
+			MaxAge: cookieExpiration, Secure: j.SecureCookies}
+		http.SetCookie(w, &xsrfCookie)
+	}
+
+	return claims, nil
+}
+
+// getSession verifies the session cookie's signature and loads the matching
+// claims from SessionStore
+func (j *Service) getSession(r *http.Request, fromCookie bool, cookieVal string) (Claims, string, error) {
+	id, err := j.verifySessionID(cookieVal)
+	if err != nil {
+		return Claims{}, "", errors.WrapPrefix(err, "invalid session cookie", 0)
+	}
+
+	claims, err := j.SessionStore.Load(id)
+	if err != nil {
+		return Claims{}, "", errors.WrapPrefix(err, "session not found", 0)
+	}
+
+	if fromCookie && !j.DisableXSRF {
+		xsrf := r.Header.Get(j.XSRFHeaderKey)
+		if claims.Id != xsrf {
+			return Claims{}, "", fmt.Errorf("xsrf mismatch")
+		}
+	}
+
+	return claims, cookieVal, nil
+}
+
+// sessionHMACKey is the secret used to sign session ids; sessions aren't
+// per-audience the way JWTs are, so this always reads the secret for the empty aud.
+func (j *Service) sessionHMACKey() (string, error) {
+	return j.secret("")
+}
+
+// signSessionID returns "<id>.<hex hmac>", the opaque cookie value for a session id
+func (j *Service) signSessionID(id string) (string, error) {
+	key, err := j.sessionHMACKey()
+	if err != nil {
+		return "", err
+	}
+	return id + "." + hmacSign(id, key), nil
+}
+
+// verifySessionID checks a cookie value produced by signSessionID and returns the session id
+func (j *Service) verifySessionID(v string) (string, error) {
+	idx := strings.LastIndex(v, ".")
+	if idx < 0 {
+		return "", errors.New("malformed session cookie")
+	}
+	id, sig := v[:idx], v[idx+1:]
+
+	key, err := j.sessionHMACKey()
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal([]byte(sig), []byte(hmacSign(id, key))) {
+		return "", errors.New("session cookie signature mismatch")
+	}
+	return id, nil
+}
+
+func hmacSign(v, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(v))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// maxCookieSize returns MaxCookieSize, or defaultMaxCookieSize if unset
+func (j *Service) maxCookieSize() int {
+	if j.MaxCookieSize > 0 {
+		return j.MaxCookieSize
+	}
+	return defaultMaxCookieSize
+}
+
+// setJWTCookie writes tokenStr as a single JWT cookie, or, if it exceeds
+// maxCookieSize, splits it across JWT_0, JWT_1, ... cookies sharing the same attributes
+func (j *Service) setJWTCookie(w http.ResponseWriter, tokenStr string, maxAge int) {
+	max := j.maxCookieSize()
+	if len(tokenStr) <= max {
+		http.SetCookie(w, &http.Cookie{Name: j.JWTCookieName, Value: tokenStr, HttpOnly: true, Path: "/",
+			MaxAge: maxAge, Secure: j.SecureCookies})
+		return
+	}
+
+	for i, start := 0, 0; start < len(tokenStr); i, start = i+1, start+max {
+		end := start + max
+		if end > len(tokenStr) {
+			end = len(tokenStr)
+		}
+		http.SetCookie(w, &http.Cookie{Name: fmt.Sprintf("%s_%d", j.JWTCookieName, i), Value: tokenStr[start:end],
+			HttpOnly: true, Path: "/", MaxAge: maxAge, Secure: j.SecureCookies})
+	}
+}
+
+// readJWTCookie reassembles the JWT from a single JWT cookie if present, falling
+// back to consecutive JWT_0, JWT_1, ... chunk cookies written by setJWTCookie
+func (j *Service) readJWTCookie(r *http.Request) (string, error) {
+	if c, err := r.Cookie(j.JWTCookieName); err == nil {
+		return c.Value, nil
+	}
+
+	var sb strings.Builder
+	for i := 0; ; i++ {
+		c, err := r.Cookie(fmt.Sprintf("%s_%d", j.JWTCookieName, i))
+		if err != nil {
+			break
+		}
+		sb.WriteString(c.Value)
+	}
+	if sb.Len() == 0 {
+		return "", errors.New("token cookie was not presented")
+	}
+	return sb.String(), nil
+}
+
+// Get token from request, from the custom header, from the Authorization: Bearer
+// header (with AuthHeaderEnabled) or from the cookie(s), in that order. On an
+// expired-but-valid token the claims are still returned alongside the error, so
+// middleware.Authenticator can attempt a refresh before giving up.
+func (j *Service) Get(r *http.Request) (Claims, string, error) {
+	fromCookie := false
+	tokenStr := r.Header.Get(j.JWTHeaderKey)
+	if tokenStr == "" && j.AuthHeaderEnabled {
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			tokenStr = strings.TrimPrefix(auth, "Bearer ")
+		}
+	}
+	if tokenStr == "" {
+		fromCookie = true
+		var err error
+		if tokenStr, err = j.readJWTCookie(r); err != nil {
+			return Claims{}, "", errors.WrapPrefix(err, "token cookie was not presented", 0)
+		}
+	}
+
+	// Only cookie-delivered tokens are ever opaque session ids (see setSession);
+	// a token presented via header is always a self-contained signed JWT, minted
+	// directly with Token, e.g. for server-to-server or admin use, so it's parsed
+	// as one regardless of SessionStore.
+	if fromCookie && j.SessionStore != nil {
+		return j.getSession(r, fromCookie, tokenStr)
+	}
+
+	claims, err := j.Parse(tokenStr)
+	if err != nil && !IsExpired(err) {
+		return Claims{}, "", errors.WrapPrefix(err, "can't parse token", 0)
+	}
+
+	// Checked regardless of err: an expired-but-validly-signed token still carries
+	// a cookie Authenticator may refresh, and that refreshed request needs the
+	// same XSRF protection as any other cookie-backed one.
+	if fromCookie && !j.DisableXSRF {
+		xsrf := r.Header.Get(j.XSRFHeaderKey)
+		if claims.Id != xsrf {
+			return Claims{}, "", fmt.Errorf("xsrf mismatch")
+		}
+	}
+
+	return claims, tokenStr, err
+}
@@ -0,0 +1,136 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testService() *Service {
+	return NewService(Opts{
+		SecretReader: SecretFunc(func(string) (string, error) { return "secret", nil }),
+	})
+}
+
+func TestService_SetGet(t *testing.T) {
+	svc := testService()
+	claims := Claims{User: &User{ID: "id1", Name: "test user"}}
+
+	w := httptest.NewRecorder()
+	_, err := svc.Set(w, claims)
+	require.NoError(t, err)
+
+	r := attachCookies(w)
+	res, _, err := svc.Get(r)
+	require.NoError(t, err)
+	assert.Equal(t, "id1", res.User.ID)
+}
+
+func TestService_SetGetLargeClaimsSplitsCookie(t *testing.T) {
+	svc := testService()
+	svc.MaxCookieSize = 100 // force chunking well below the default threshold
+
+	claims := Claims{User: &User{ID: "id1", Name: "test user", Attributes: map[string]interface{}{
+		"blob": strings.Repeat("x", 1000),
+	}}}
+
+	w := httptest.NewRecorder()
+	_, err := svc.Set(w, claims)
+	require.NoError(t, err)
+
+	cookies := w.Result().Cookies()
+	var chunkCount int
+	for _, c := range cookies {
+		if strings.HasPrefix(c.Name, "JWT_") {
+			chunkCount++
+		}
+	}
+	assert.True(t, chunkCount > 1, "expected the oversized token to be split across chunk cookies")
+
+	r := attachCookies(w)
+	res, _, err := svc.Get(r)
+	require.NoError(t, err)
+	assert.Equal(t, "id1", res.User.ID)
+	assert.Equal(t, 1000, len(res.User.Attributes["blob"].(string)))
+}
+
+func TestService_GetChecksXSRFOnExpiredToken(t *testing.T) {
+	svc := testService()
+	claims := Claims{User: &User{ID: "id1"}}
+	claims.ExpiresAt = time.Now().Add(-time.Minute).Unix() // already expired when issued
+
+	w := httptest.NewRecorder()
+	_, err := svc.Set(w, claims)
+	require.NoError(t, err)
+
+	r := attachCookies(w)
+	r.Header.Set(svc.XSRFHeaderKey, "wrong-xsrf-value")
+	_, _, err = svc.Get(r)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "xsrf mismatch")
+}
+
+// attachCookies builds a request carrying w's cookies, echoing the XSRF cookie
+// back as the XSRF header too, the way a browser's double-submit JS would.
+func attachCookies(w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+		if c.Name == "XSRF-TOKEN" {
+			r.Header.Set("X-XSRF-TOKEN", c.Value)
+		}
+	}
+	return r
+}
+
+type fakeSessionStore map[string]Claims
+
+func (f fakeSessionStore) Save(id string, claims Claims) error { f[id] = claims; return nil }
+func (f fakeSessionStore) Load(id string) (Claims, error)      { return f[id], nil }
+func (f fakeSessionStore) Delete(id string) error              { delete(f, id); return nil }
+
+func TestService_SetGetWithSessionStore(t *testing.T) {
+	svc := testService()
+	store := fakeSessionStore{}
+	svc.SessionStore = store
+	claims := Claims{User: &User{ID: "id1", Name: "test user"}}
+
+	w := httptest.NewRecorder()
+	_, err := svc.Set(w, claims)
+	require.NoError(t, err)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 2) // JWT (opaque session id) + XSRF
+	assert.Len(t, store, 1)
+	assert.NotContains(t, cookies[0].Value, "id1") // cookie carries no claims, just the signed id
+
+	r := attachCookies(w)
+	res, _, err := svc.Get(r)
+	require.NoError(t, err)
+	assert.Equal(t, "id1", res.User.ID)
+}
+
+func TestService_GetWithSessionStoreRejectsTamperedCookie(t *testing.T) {
+	svc := testService()
+	svc.SessionStore = fakeSessionStore{}
+	claims := Claims{User: &User{ID: "id1"}}
+
+	w := httptest.NewRecorder()
+	_, err := svc.Set(w, claims)
+	require.NoError(t, err)
+
+	cookies := w.Result().Cookies()
+	cookies[0].Value += "tampered"
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	_, _, err = svc.Get(r)
+	assert.Error(t, err)
+}